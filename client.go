@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// ClientConfig tunes the shared *http.Client used for every request, in
+// place of the old per-request http.Client{} that defeated keep-alive.
+type ClientConfig struct {
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	DisableCompression  bool
+	HTTP2               bool
+}
+
+// NewHTTPClient builds a client with a Transport tuned from cfg. Callers
+// should reuse the returned client for every request of the run so
+// connections are kept alive instead of being re-established each time.
+func NewHTTPClient(cfg ClientConfig) *http.Client {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		DisableCompression:  cfg.DisableCompression,
+	}
+	if !cfg.HTTP2 {
+		// A non-nil, empty TLSNextProto map disables the transport's
+		// automatic HTTP/2 upgrade over TLS.
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyEstimator tracks a stream of observed request durations using
+// bounded memory and reports approximate percentiles, so long runs don't
+// keep an ever-growing slice of every sample and re-sort it on each tick.
+// Implementations must be safe for concurrent use from the request
+// goroutines.
+type LatencyEstimator interface {
+	Record(d time.Duration)
+	Quantile(p float64) time.Duration
+
+	// BucketCounts returns, for each bound in ascending order, the number
+	// of observations less than or equal to that bound (i.e. Prometheus's
+	// cumulative histogram bucket convention).
+	BucketCounts(bounds []time.Duration) []int64
+}
+
+// ReservoirEstimator keeps a uniform random sample of up to Size
+// observations using Vitter's Algorithm R, and reports percentiles by
+// sorting the reservoir.
+type ReservoirEstimator struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	size   int
+	count  int64
+	sample []time.Duration
+}
+
+// NewReservoirEstimator creates a reservoir of the given size.
+func NewReservoirEstimator(size int) *ReservoirEstimator {
+	return &ReservoirEstimator{
+		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		size: size,
+	}
+}
+
+// Record implements LatencyEstimator.
+func (r *ReservoirEstimator) Record(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	if len(r.sample) < r.size {
+		r.sample = append(r.sample, d)
+		return
+	}
+	j := r.rng.Int63n(r.count)
+	if j < int64(r.size) {
+		r.sample[j] = d
+	}
+}
+
+// Quantile implements LatencyEstimator.
+func (r *ReservoirEstimator) Quantile(p float64) time.Duration {
+	r.mu.Lock()
+	sample := make([]time.Duration, len(r.sample))
+	copy(sample, r.sample)
+	r.mu.Unlock()
+
+	if len(sample) == 0 {
+		return 0
+	}
+	sort.Slice(sample, func(i, j int) bool { return sample[i] < sample[j] })
+	return percentile(sample, p)
+}
+
+// BucketCounts implements LatencyEstimator by counting the reservoir
+// sample against bounds and scaling the result up to the total number of
+// observations; like Quantile, this is only as accurate as the sample.
+func (r *ReservoirEstimator) BucketCounts(bounds []time.Duration) []int64 {
+	r.mu.Lock()
+	sample := make([]time.Duration, len(r.sample))
+	copy(sample, r.sample)
+	total := r.count
+	r.mu.Unlock()
+
+	counts := make([]int64, len(bounds))
+	for _, d := range sample {
+		for i, bound := range bounds {
+			if d <= bound {
+				counts[i]++
+			}
+		}
+	}
+	if n := int64(len(sample)); n > 0 && total > n {
+		for i := range counts {
+			counts[i] = counts[i] * total / n
+		}
+	}
+	return counts
+}
+
+// HDREstimator is a logarithmic-bucket latency histogram covering
+// [min, max] with the given number of significant digits, in the style of
+// HdrHistogram: each observation increments bucket
+// floor(log(d/min)/log(base)), and percentiles are computed by walking
+// cumulative bucket counts.
+type HDREstimator struct {
+	mu      sync.Mutex
+	min     time.Duration
+	max     time.Duration
+	base    float64
+	buckets []int64
+	total   int64
+}
+
+// NewHDREstimator creates an estimator covering [min, max] with sigFigs
+// significant digits of precision. Precision is per decade: sigFigs=3 means
+// each order-of-magnitude span is divided into 10^3 sub-buckets, so
+// adjacent bucket boundaries differ by a fraction of a percent rather than
+// the >100% step a naive 1/sigFigs exponent would produce.
+func NewHDREstimator(min, max time.Duration, sigFigs int) *HDREstimator {
+	subBucketsPerDecade := math.Pow(10, float64(sigFigs))
+	base := math.Pow(10, 1/subBucketsPerDecade)
+	numBuckets := int(math.Ceil(math.Log(float64(max)/float64(min))/math.Log(base))) + 1
+	return &HDREstimator{
+		min:     min,
+		max:     max,
+		base:    base,
+		buckets: make([]int64, numBuckets),
+	}
+}
+
+// Record implements LatencyEstimator.
+func (h *HDREstimator) Record(d time.Duration) {
+	if d < h.min {
+		d = h.min
+	}
+	if d > h.max {
+		d = h.max
+	}
+	idx := int(math.Floor(math.Log(float64(d)/float64(h.min)) / math.Log(h.base)))
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(h.buckets) {
+		idx = len(h.buckets) - 1
+	}
+
+	h.mu.Lock()
+	h.buckets[idx]++
+	h.total++
+	h.mu.Unlock()
+}
+
+// Quantile implements LatencyEstimator.
+func (h *HDREstimator) Quantile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(p * float64(h.total)))
+	var cumulative int64
+	for idx, count := range h.buckets {
+		cumulative += count
+		if cumulative >= target {
+			return time.Duration(float64(h.min) * math.Pow(h.base, float64(idx)))
+		}
+	}
+	return h.max
+}
+
+// BucketCounts implements LatencyEstimator by summing the log-buckets that
+// fall at or below each requested bound.
+func (h *HDREstimator) BucketCounts(bounds []time.Duration) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make([]int64, len(bounds))
+	for i, bound := range bounds {
+		if bound < h.min {
+			continue
+		}
+		idx := int(math.Floor(math.Log(float64(bound)/float64(h.min)) / math.Log(h.base)))
+		if idx >= len(h.buckets) {
+			idx = len(h.buckets) - 1
+		}
+		var cumulative int64
+		for j := 0; j <= idx; j++ {
+			cumulative += h.buckets[j]
+		}
+		counts[i] = cumulative
+	}
+	return counts
+}
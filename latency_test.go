@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// recordUniformMillis feeds e a sample for every millisecond in [1, n].
+func recordUniformMillis(e LatencyEstimator, n int) {
+	for i := 1; i <= n; i++ {
+		e.Record(time.Duration(i) * time.Millisecond)
+	}
+}
+
+func TestHDREstimatorQuantilesAreDistinct(t *testing.T) {
+	e := NewHDREstimator(hdrMinLatency, hdrMaxLatency, 3)
+	recordUniformMillis(e, 1000)
+
+	p50 := e.Quantile(0.50)
+	p90 := e.Quantile(0.90)
+	p95 := e.Quantile(0.95)
+	p99 := e.Quantile(0.99)
+
+	if !(p50 < p90 && p90 < p95 && p95 < p99) {
+		t.Fatalf("expected p50 < p90 < p95 < p99, got p50=%s p90=%s p95=%s p99=%s", p50, p90, p95, p99)
+	}
+}
+
+func TestHDREstimatorBucketCounts(t *testing.T) {
+	e := NewHDREstimator(hdrMinLatency, hdrMaxLatency, 3)
+	recordUniformMillis(e, 1000)
+
+	bounds := []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 1000 * time.Millisecond}
+	counts := e.BucketCounts(bounds)
+
+	if counts[0] <= 0 || counts[0] >= 1000 {
+		t.Fatalf("expected the 100ms bucket to hold a strict subset of samples, got %d", counts[0])
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] < counts[i-1] {
+			t.Fatalf("bucket counts must be non-decreasing cumulatively, got %v", counts)
+		}
+	}
+	if counts[len(counts)-1] != 1000 {
+		t.Fatalf("expected the 1000ms bucket to cover all samples, got %d", counts[len(counts)-1])
+	}
+}
+
+func TestReservoirEstimatorQuantilesAreDistinct(t *testing.T) {
+	e := NewReservoirEstimator(10000)
+	recordUniformMillis(e, 1000)
+
+	p50 := e.Quantile(0.50)
+	p90 := e.Quantile(0.90)
+	p99 := e.Quantile(0.99)
+
+	if !(p50 < p90 && p90 < p99) {
+		t.Fatalf("expected p50 < p90 < p99, got p50=%s p90=%s p99=%s", p50, p90, p99)
+	}
+}
+
+func TestReservoirEstimatorBoundedSize(t *testing.T) {
+	e := NewReservoirEstimator(100)
+	recordUniformMillis(e, 10000)
+
+	if len(e.sample) != 100 {
+		t.Fatalf("expected reservoir to stay bounded at 100, got %d", len(e.sample))
+	}
+}
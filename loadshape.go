@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// LoadShape determines the target request rate at a given point in an
+// elapsed run. The main loop periodically calls
+// limiter.SetLimit(shape.RateAt(elapsed)) so traffic can model warm-ups,
+// bursts, and other non-steady-state patterns instead of only a flat RPS.
+type LoadShape interface {
+	RateAt(elapsed time.Duration) rate.Limit
+}
+
+// ConstantShape holds a fixed rate for the whole run; this is the
+// pre-existing behavior and the default when --load-shape is unset.
+type ConstantShape struct {
+	RPS float64
+}
+
+func (s ConstantShape) RateAt(elapsed time.Duration) rate.Limit {
+	return rate.Limit(s.RPS)
+}
+
+// RampShape scales linearly from Start to End over Duration, then holds at
+// End.
+type RampShape struct {
+	Start    float64
+	End      float64
+	Duration time.Duration
+}
+
+func (s RampShape) RateAt(elapsed time.Duration) rate.Limit {
+	if s.Duration <= 0 || elapsed >= s.Duration {
+		return rate.Limit(s.End)
+	}
+	frac := float64(elapsed) / float64(s.Duration)
+	return rate.Limit(s.Start + frac*(s.End-s.Start))
+}
+
+// StepSegment is one duration@rps segment of a StepsShape.
+type StepSegment struct {
+	Duration time.Duration
+	RPS      float64
+}
+
+// StepsShape holds each segment's rate in turn, then holds at the last
+// segment's rate once all segments have elapsed.
+type StepsShape struct {
+	Segments []StepSegment
+}
+
+func (s StepsShape) RateAt(elapsed time.Duration) rate.Limit {
+	if len(s.Segments) == 0 {
+		return 0
+	}
+	var cumulative time.Duration
+	for _, seg := range s.Segments {
+		cumulative += seg.Duration
+		if elapsed < cumulative {
+			return rate.Limit(seg.RPS)
+		}
+	}
+	return rate.Limit(s.Segments[len(s.Segments)-1].RPS)
+}
+
+// parseStepsShape parses a comma-separated list of duration@rps segments,
+// e.g. "10s@5,30s@20,1m@5", as used by --load-shape=steps via --steps.
+func parseStepsShape(spec string) (*StepsShape, error) {
+	var segments []StepSegment
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.SplitN(part, "@", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid --steps segment %q, want duration@rps", part)
+		}
+		d, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in --steps segment %q: %w", part, err)
+		}
+		r, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rps in --steps segment %q: %w", part, err)
+		}
+		segments = append(segments, StepSegment{Duration: d, RPS: r})
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("--steps requires at least one duration@rps segment")
+	}
+	return &StepsShape{Segments: segments}, nil
+}
+
+// SineShape oscillates between Min and Max with the given Period.
+type SineShape struct {
+	Min    float64
+	Max    float64
+	Period time.Duration
+}
+
+func (s SineShape) RateAt(elapsed time.Duration) rate.Limit {
+	if s.Period <= 0 {
+		return rate.Limit(s.Min)
+	}
+	phase := 2 * math.Pi * float64(elapsed) / float64(s.Period)
+	mid := (s.Min + s.Max) / 2
+	amplitude := (s.Max - s.Min) / 2
+	return rate.Limit(mid + amplitude*math.Sin(phase))
+}
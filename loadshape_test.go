@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConstantShapeRateAt(t *testing.T) {
+	s := ConstantShape{RPS: 42}
+	for _, elapsed := range []time.Duration{0, time.Second, time.Hour} {
+		if got := s.RateAt(elapsed); got != 42 {
+			t.Fatalf("RateAt(%s) = %v, want 42", elapsed, got)
+		}
+	}
+}
+
+func TestRampShapeRateAt(t *testing.T) {
+	s := RampShape{Start: 0, End: 100, Duration: 10 * time.Second}
+
+	if got := s.RateAt(0); got != 0 {
+		t.Fatalf("RateAt(0) = %v, want 0", got)
+	}
+	if got := s.RateAt(5 * time.Second); got != 50 {
+		t.Fatalf("RateAt(5s) = %v, want 50", got)
+	}
+	if got := s.RateAt(10 * time.Second); got != 100 {
+		t.Fatalf("RateAt(10s) = %v, want 100", got)
+	}
+	if got := s.RateAt(20 * time.Second); got != 100 {
+		t.Fatalf("RateAt(20s) past Duration = %v, want held at 100", got)
+	}
+}
+
+func TestStepsShapeRateAt(t *testing.T) {
+	s := StepsShape{Segments: []StepSegment{
+		{Duration: 10 * time.Second, RPS: 5},
+		{Duration: 10 * time.Second, RPS: 20},
+	}}
+
+	if got := s.RateAt(0); got != 5 {
+		t.Fatalf("RateAt(0) = %v, want 5", got)
+	}
+	if got := s.RateAt(15 * time.Second); got != 20 {
+		t.Fatalf("RateAt(15s) = %v, want 20", got)
+	}
+	if got := s.RateAt(30 * time.Second); got != 20 {
+		t.Fatalf("RateAt(30s) past last segment = %v, want held at 20", got)
+	}
+}
+
+func TestParseStepsShape(t *testing.T) {
+	shape, err := parseStepsShape("10s@5,30s@20,1m@5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(shape.Segments) != 3 {
+		t.Fatalf("expected 3 segments, got %d", len(shape.Segments))
+	}
+
+	if _, err := parseStepsShape(""); err == nil {
+		t.Fatal("expected an error for an empty --steps spec")
+	}
+	if _, err := parseStepsShape("10s-5"); err == nil {
+		t.Fatal("expected an error for a malformed segment")
+	}
+}
+
+func TestSineShapeRateAt(t *testing.T) {
+	s := SineShape{Min: 10, Max: 30, Period: 4 * time.Second}
+
+	if got := s.RateAt(0); got != 20 {
+		t.Fatalf("RateAt(0) = %v, want midpoint 20", got)
+	}
+	if got := s.RateAt(1 * time.Second); got != 30 {
+		t.Fatalf("RateAt(period/4) = %v, want peak 30", got)
+	}
+	if got := s.RateAt(3 * time.Second); got != 10 {
+		t.Fatalf("RateAt(3*period/4) = %v, want trough 10", got)
+	}
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
-	"math"
 	"net/http"
 	"os"
-	"os/exec"
-	"runtime"
-	"slices"
 	"strings"
 	"time"
 
@@ -18,6 +15,28 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// Fixed range covered by the hdr latency estimator; wide enough for
+// anything from a cache hit to a badly stalled backend.
+const (
+	hdrMinLatency = 1 * time.Microsecond
+	hdrMaxLatency = 60 * time.Second
+)
+
+var defaultLatencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
 func main() {
 	// Define flags
 	rps := flag.Float64("rps", 0, "Requests per second (required)")
@@ -26,6 +45,26 @@ func main() {
 	// headers is a list of headers to include in the request
 	headers := flag.StringSlice("headers", []string{}, "Headers to include in the request")
 	duration := flag.Duration("duration", 0, "Duration to run the test for in time format (e.g. 1h30m, 10s, 100ms)")
+	metricsListen := flag.String("metrics-listen", "", "Address to serve Prometheus /metrics and /metrics/stream on (e.g. :9090); disabled if empty")
+	metricsBuckets := flag.DurationSlice("metrics-buckets", defaultLatencyBuckets, "Upper bounds of the Prometheus latency histogram buckets")
+	latencyEstimator := flag.String("latency-estimator", "reservoir", "Latency percentile estimator to use: reservoir or hdr")
+	reservoirSize := flag.Int("reservoir-size", 10000, "Sample size for the reservoir latency estimator")
+	hdrSigFigs := flag.Int("hdr-sigfigs", 3, "Significant digits of precision for the hdr latency estimator (must be > 0)")
+	scenarioPath := flag.String("scenario", "", "Path to a YAML/JSON scenario file defining multiple weighted or chained request steps, instead of hitting a single --address")
+	loadShapeFlag := flag.String("load-shape", "constant", "Load shape to apply to --rps over the run: constant, ramp, steps, or sine")
+	rpsStart := flag.Float64("rps-start", 0, "Starting rps for --load-shape=ramp; ramps linearly up to --rps")
+	rampDuration := flag.Duration("ramp-duration", 0, "Duration to ramp from --rps-start to --rps for --load-shape=ramp")
+	stepsSpec := flag.String("steps", "", "Comma-separated duration@rps segments for --load-shape=steps, e.g. 10s@5,30s@20,1m@5")
+	sineMin := flag.Float64("sine-min", 0, "Minimum rps for --load-shape=sine")
+	sineMax := flag.Float64("sine-max", 0, "Maximum rps for --load-shape=sine")
+	sinePeriod := flag.Duration("sine-period", 1*time.Minute, "Oscillation period for --load-shape=sine")
+	maxIdleConnsPerHost := flag.Int("max-idle-conns-per-host", 100, "Transport MaxIdleConnsPerHost for the shared HTTP client")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "Transport MaxConnsPerHost for the shared HTTP client (0 = unlimited)")
+	idleConnTimeout := flag.Duration("idle-conn-timeout", 90*time.Second, "Transport IdleConnTimeout for the shared HTTP client")
+	disableCompression := flag.Bool("disable-compression", false, "Disable transparent response compression")
+	http2 := flag.Bool("http2", true, "Allow HTTP/2 (disable to force HTTP/1.1 keep-alive connections)")
+	timeout := flag.Duration("timeout", 0, "Per-request timeout; 0 disables the deadline")
+	maxInflight := flag.Int("max-inflight", 1000, "Maximum in-flight requests; RPS overshoots beyond this are dropped instead of spawning unbounded goroutines (0 = unlimited)")
 	flag.Parse()
 
 	// Validate that required flags are provided
@@ -35,145 +74,148 @@ func main() {
 		os.Exit(1)
 	}
 
-	if *address == "" {
-		fmt.Println("Error: The 'address' flag is required.")
+	if *address == "" && *scenarioPath == "" {
+		fmt.Println("Error: The 'address' flag is required unless 'scenario' is set.")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	started := time.Now()
-	lastPrint := time.Now()
-	requests := 0
-	limiter := rate.NewLimiter(rate.Limit(*rps), 1)
-
-	successChannel := make(chan time.Duration, 100)
-	successCount := 0
-	successDurations := []time.Duration{}
-
-	errorsChannel := make(chan string, 100)
-	errorCount := 0
-	errors := []string{}
-
-	for {
-		select {
-		case duration := <-successChannel:
-			successDurations = append(successDurations, duration)
-			successCount++
-		case errMsg := <-errorsChannel:
-			errorCount++
-			errors = append(errors, errMsg)
-		default:
-			if limiter.Allow() {
-				go doRequest(*address, *headers, *authentication, successChannel, errorsChannel)
-				requests++
-			}
-
-			elapsed := time.Since(started)
-			if time.Since(lastPrint) <= 1*time.Second {
-				printMetrics(requests, successCount, errorCount, successDurations, errors, duration, elapsed, false)
-				lastPrint = time.Now()
-			}
-			if *duration > 0 && time.Since(started) > *duration {
-				printMetrics(requests, successCount, errorCount, successDurations, errors, duration, elapsed, true)
-				os.Exit(0)
-			}
+	var scenario *Scenario
+	var picker *weightedPicker
+	if *scenarioPath != "" {
+		var err error
+		scenario, err = LoadScenario(*scenarioPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !scenario.Chain {
+			picker = newWeightedPicker(scenario.Steps)
 		}
+	}
 
+	if *latencyEstimator == "hdr" && *hdrSigFigs <= 0 {
+		fmt.Printf("Error: The 'hdr-sigfigs' flag must be greater than 0, got %d.\n", *hdrSigFigs)
+		os.Exit(1)
 	}
 
-}
+	var latency LatencyEstimator
+	switch *latencyEstimator {
+	case "reservoir":
+		latency = NewReservoirEstimator(*reservoirSize)
+	case "hdr":
+		latency = NewHDREstimator(hdrMinLatency, hdrMaxLatency, *hdrSigFigs)
+	default:
+		fmt.Printf("Error: The 'latency-estimator' flag must be 'reservoir' or 'hdr', got %q.\n", *latencyEstimator)
+		os.Exit(1)
+	}
 
-func printMetrics(requests int, successCount int, errorCount int, successDurations []time.Duration, errors []string, duration *time.Duration, elapsed time.Duration, printTimes bool) {
-	currentRps := float64(requests) / elapsed.Seconds()
-	// count different errors and show
-	formattedErrors := ""
-	if len(errors) > 0 {
-		errorMap := make(map[string]int)
-		for _, err := range errors {
-			errorMap[err]++
+	var shape LoadShape
+	switch *loadShapeFlag {
+	case "constant":
+		shape = ConstantShape{RPS: *rps}
+	case "ramp":
+		shape = RampShape{Start: *rpsStart, End: *rps, Duration: *rampDuration}
+	case "steps":
+		stepsShape, err := parseStepsShape(*stepsSpec)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
 		}
-		for k, v := range errorMap {
-			formattedErrors += fmt.Sprintf("Error %s: %d\n", k, v)
+		shape = *stepsShape
+	case "sine":
+		if *sineMax <= *sineMin {
+			fmt.Printf("Error: The 'sine-max' flag must be greater than 'sine-min' for --load-shape=sine, got sine-min=%g, sine-max=%g.\n", *sineMin, *sineMax)
+			os.Exit(1)
 		}
+		shape = SineShape{Min: *sineMin, Max: *sineMax, Period: *sinePeriod}
+	default:
+		fmt.Printf("Error: The 'load-shape' flag must be one of constant, ramp, steps, sine, got %q.\n", *loadShapeFlag)
+		os.Exit(1)
 	}
 
-	slices.Sort(successDurations)
-	p99 := percentile(successDurations, 0.99)
-	p95 := percentile(successDurations, 0.95)
-	p90 := percentile(successDurations, 0.90)
-	avg := time.Duration(0)
-	if len(successDurations) > 0 {
-		for _, d := range successDurations {
-			avg += d
-		}
-		avg = avg / time.Duration(len(successDurations))
-	}
+	started := time.Now()
+	lastPrint := time.Now()
+	limiter := rate.NewLimiter(rate.Limit(*rps), 1)
 
-	// metrics
-	metrics := map[string]interface{}{
-		"requests":      requests,
-		"elapsed":       elapsed.Truncate(time.Second),
-		"rps":           fmt.Sprintf("%.2f", currentRps),
-		"success count": successCount,
-		"error count":   errorCount,
-		"avg duration":  avg.Round(time.Millisecond),
+	collector := NewCollector(latency, *metricsBuckets)
+	client := NewHTTPClient(ClientConfig{
+		MaxIdleConnsPerHost: *maxIdleConnsPerHost,
+		MaxConnsPerHost:     *maxConnsPerHost,
+		IdleConnTimeout:     *idleConnTimeout,
+		DisableCompression:  *disableCompression,
+		HTTP2:               *http2,
+	})
+	var inflight chan struct{}
+	if *maxInflight > 0 {
+		inflight = make(chan struct{}, *maxInflight)
 	}
-	if *duration > 0 {
-		metrics["duration"] = *duration
-	}
-	var formated string
 
-	keys := []string{}
-	for k := range metrics {
-		keys = append(keys, k)
-	}
-	slices.Sort(keys)
-	for _, key := range keys {
-		value := metrics[key]
-		formated += fmt.Sprintf("%s: %v ", key, value)
-	}
-	clearScreen()
-	log.Print(formattedErrors)
-	log.Print(formated)
-	if printTimes {
-		latency := fmt.Sprintf("p99: %s, p95: %s, p90: %s", p99.Round(time.Millisecond), p95.Round(time.Millisecond), p90.Round(time.Millisecond))
-		log.Print(latency)
+	if *metricsListen != "" {
+		go serveMetrics(*metricsListen, collector)
 	}
-}
 
-func percentile(durations []time.Duration, p float64) time.Duration {
-	if len(durations) == 0 {
-		return 0
-	}
-	idx := int(math.Ceil(p*float64(len(durations)))) - 1
-	if idx < 0 {
-		idx = 0
-	}
-	if idx >= len(durations) {
-		idx = len(durations) - 1
+	for {
+		elapsed := time.Since(started)
+		limiter.SetLimit(shape.RateAt(elapsed))
+
+		if limiter.Allow() {
+			if scenario != nil {
+				dispatch(inflight, collector, func() {
+					runScenarioIteration(client, scenario, picker, *timeout, collector)
+				})
+			} else {
+				dispatch(inflight, collector, func() {
+					doRequest(client, *address, *headers, *authentication, *timeout, collector)
+				})
+			}
+		}
+
+		if time.Since(lastPrint) >= 1*time.Second {
+			printMetrics(collector, duration, false)
+			lastPrint = time.Now()
+		}
+		if *duration > 0 && elapsed > *duration {
+			printMetrics(collector, duration, true)
+			os.Exit(0)
+		}
 	}
-	return durations[idx]
 }
 
-func clearScreen() {
-	switch runtime.GOOS {
-	case "linux", "darwin": // Unix-like systems
-		cmd := exec.Command("clear")
-		cmd.Stdout = os.Stdout
-		cmd.Run()
-	case "windows": // Windows system
-		cmd := exec.Command("cmd", "/c", "cls")
-		cmd.Stdout = os.Stdout
-		cmd.Run()
+// dispatch runs fn in a new goroutine, bounded by inflight so that RPS
+// overshoots (the server slowing down while the limiter keeps allowing
+// ticks) drop the extra work instead of spawning unbounded goroutines. A
+// nil inflight (--max-inflight=0) means unlimited, matching the
+// --max-conns-per-host convention.
+func dispatch(inflight chan struct{}, collector *Collector, fn func()) {
+	if inflight == nil {
+		collector.RecordRequest()
+		go fn()
+		return
+	}
+	select {
+	case inflight <- struct{}{}:
+		collector.RecordRequest()
+		go func() {
+			defer func() { <-inflight }()
+			fn()
+		}()
+	default:
 	}
 }
 
-func doRequest(url string, headers []string, authentication string, successChannel chan time.Duration, errorsChannel chan string) {
-	client := &http.Client{}
+func doRequest(client *http.Client, url string, headers []string, authentication string, timeout time.Duration, collector *Collector) {
 	start := time.Now()
-	req, err := http.NewRequest("GET", url, nil)
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		errorsChannel <- "Error creating request"
+		collector.RecordError("Error creating request")
 		return
 	}
 	for _, header := range headers {
@@ -188,18 +230,20 @@ func doRequest(url string, headers []string, authentication string, successChann
 	if authentication != "" {
 		req.Header.Set("Authentication", fmt.Sprintf("bearer %s", authentication))
 	}
+
 	resp, err := client.Do(req)
-	io.Copy(io.Discard, resp.Body)
 	if err != nil {
-		errorsChannel <- "Error making request"
+		collector.RecordError("Error making request")
 		return
 	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
 	elapsed := time.Since(start)
 	if resp.StatusCode != 200 {
 		log.Printf("Error: Status code %d", resp.StatusCode)
-		errorsChannel <- fmt.Sprintf("%d", resp.StatusCode)
+		collector.RecordError(fmt.Sprintf("%d", resp.StatusCode))
 		return
 	}
-	successChannel <- elapsed
-	defer resp.Body.Close()
+	collector.RecordSuccess(elapsed)
 }
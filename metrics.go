@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Collector aggregates load-test metrics from the request goroutines and is
+// safe for concurrent use. Both the terminal renderer and the HTTP metrics
+// endpoints read from the same Collector instead of recomputing everything
+// from ever-growing slices on each tick. Latency percentiles are delegated
+// to a LatencyEstimator so memory stays bounded on long runs.
+type Collector struct {
+	mu sync.Mutex
+
+	started time.Time
+
+	requests       int
+	successCount   int
+	errorCount     int
+	errorsByStatus map[string]int
+	totalDuration  time.Duration
+
+	latency        LatencyEstimator
+	latencyBuckets []time.Duration // upper bounds, ascending, for the Prometheus histogram
+
+	steps map[string]*StepStats
+}
+
+// StepStats tracks success/error counts for a single named scenario step,
+// kept separately from the overall totals so a scenario's steps can be
+// compared against each other in the metrics output.
+type StepStats struct {
+	SuccessCount   int
+	ErrorCount     int
+	ErrorsByStatus map[string]int
+}
+
+// NewCollector creates a Collector backed by the given latency estimator.
+// latencyBuckets are the upper bounds (ascending) used when exporting the
+// Prometheus latency histogram.
+func NewCollector(latency LatencyEstimator, latencyBuckets []time.Duration) *Collector {
+	return &Collector{
+		started:        time.Now(),
+		errorsByStatus: make(map[string]int),
+		latency:        latency,
+		latencyBuckets: latencyBuckets,
+	}
+}
+
+// LatencyBucketCounts returns the cumulative histogram bucket counts for
+// the collector's configured latency buckets.
+func (c *Collector) LatencyBucketCounts() []int64 {
+	return c.latency.BucketCounts(c.latencyBuckets)
+}
+
+// RecordRequest counts a request being dispatched.
+func (c *Collector) RecordRequest() {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+}
+
+// RecordSuccess records the duration of a successful request.
+func (c *Collector) RecordSuccess(d time.Duration) {
+	c.latency.Record(d)
+	c.mu.Lock()
+	c.successCount++
+	c.totalDuration += d
+	c.mu.Unlock()
+}
+
+// RecordError records a failed request, keyed by status (or a short reason
+// when no status code is available).
+func (c *Collector) RecordError(status string) {
+	c.mu.Lock()
+	c.errorCount++
+	c.errorsByStatus[status]++
+	c.mu.Unlock()
+}
+
+// RecordStepSuccess records a successful scenario step, both in the
+// overall totals and under the step's own name.
+func (c *Collector) RecordStepSuccess(step string, d time.Duration) {
+	c.RecordSuccess(d)
+	c.mu.Lock()
+	c.stepStats(step).SuccessCount++
+	c.mu.Unlock()
+}
+
+// RecordStepError records a failed scenario step, both in the overall
+// totals and under the step's own name.
+func (c *Collector) RecordStepError(step string, status string) {
+	c.RecordError(status)
+	c.mu.Lock()
+	s := c.stepStats(step)
+	s.ErrorCount++
+	s.ErrorsByStatus[status]++
+	c.mu.Unlock()
+}
+
+// stepStats returns the StepStats for name, creating it if needed. Callers
+// must hold c.mu.
+func (c *Collector) stepStats(name string) *StepStats {
+	if c.steps == nil {
+		c.steps = make(map[string]*StepStats)
+	}
+	s, ok := c.steps[name]
+	if !ok {
+		s = &StepStats{ErrorsByStatus: make(map[string]int)}
+		c.steps[name] = s
+	}
+	return s
+}
+
+// Snapshot is a point-in-time copy of the collector state that can be read
+// without holding the lock.
+type Snapshot struct {
+	Requests       int
+	SuccessCount   int
+	ErrorCount     int
+	ErrorsByStatus map[string]int
+	AvgDuration    time.Duration
+	Elapsed        time.Duration
+
+	P50 time.Duration
+	P90 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+
+	Steps map[string]StepStats
+}
+
+// Snapshot copies out the current state under lock and asks the latency
+// estimator for the current percentiles.
+func (c *Collector) Snapshot() Snapshot {
+	c.mu.Lock()
+	avg := time.Duration(0)
+	if c.successCount > 0 {
+		avg = c.totalDuration / time.Duration(c.successCount)
+	}
+	errCopy := make(map[string]int, len(c.errorsByStatus))
+	for k, v := range c.errorsByStatus {
+		errCopy[k] = v
+	}
+	var stepsCopy map[string]StepStats
+	if len(c.steps) > 0 {
+		stepsCopy = make(map[string]StepStats, len(c.steps))
+		for name, s := range c.steps {
+			errByStatus := make(map[string]int, len(s.ErrorsByStatus))
+			for k, v := range s.ErrorsByStatus {
+				errByStatus[k] = v
+			}
+			stepsCopy[name] = StepStats{
+				SuccessCount:   s.SuccessCount,
+				ErrorCount:     s.ErrorCount,
+				ErrorsByStatus: errByStatus,
+			}
+		}
+	}
+	snap := Snapshot{
+		Requests:       c.requests,
+		SuccessCount:   c.successCount,
+		ErrorCount:     c.errorCount,
+		ErrorsByStatus: errCopy,
+		AvgDuration:    avg,
+		Elapsed:        time.Since(c.started),
+		Steps:          stepsCopy,
+	}
+	c.mu.Unlock()
+
+	snap.P50 = c.latency.Quantile(0.50)
+	snap.P90 = c.latency.Quantile(0.90)
+	snap.P95 = c.latency.Quantile(0.95)
+	snap.P99 = c.latency.Quantile(0.99)
+	return snap
+}
+
+func printMetrics(collector *Collector, configuredDuration *time.Duration, printTimes bool) {
+	snap := collector.Snapshot()
+	currentRps := float64(snap.Requests) / snap.Elapsed.Seconds()
+
+	// count different errors and show
+	formattedErrors := ""
+	if len(snap.ErrorsByStatus) > 0 {
+		for k, v := range snap.ErrorsByStatus {
+			formattedErrors += fmt.Sprintf("Error %s: %d\n", k, v)
+		}
+	}
+
+	// metrics
+	metrics := map[string]interface{}{
+		"requests":      snap.Requests,
+		"elapsed":       snap.Elapsed.Truncate(time.Second),
+		"rps":           fmt.Sprintf("%.2f", currentRps),
+		"success count": snap.SuccessCount,
+		"error count":   snap.ErrorCount,
+		"avg duration":  snap.AvgDuration.Round(time.Millisecond),
+	}
+	if *configuredDuration > 0 {
+		metrics["duration"] = *configuredDuration
+	}
+	var formated string
+
+	keys := []string{}
+	for k := range metrics {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := metrics[key]
+		formated += fmt.Sprintf("%s: %v ", key, value)
+	}
+	clearScreen()
+	log.Print(formattedErrors)
+	log.Print(formated)
+	if printTimes {
+		latency := fmt.Sprintf("p99: %s, p95: %s, p90: %s", snap.P99.Round(time.Millisecond), snap.P95.Round(time.Millisecond), snap.P90.Round(time.Millisecond))
+		log.Print(latency)
+	}
+	if len(snap.Steps) > 0 {
+		for _, name := range sortedStepNames(snap.Steps) {
+			s := snap.Steps[name]
+			log.Printf("step %s: success: %d error: %d", name, s.SuccessCount, s.ErrorCount)
+		}
+	}
+}
+
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p*float64(len(durations)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(durations) {
+		idx = len(durations) - 1
+	}
+	return durations[idx]
+}
+
+func clearScreen() {
+	switch runtime.GOOS {
+	case "linux", "darwin": // Unix-like systems
+		cmd := exec.Command("clear")
+		cmd.Stdout = os.Stdout
+		cmd.Run()
+	case "windows": // Windows system
+		cmd := exec.Command("cmd", "/c", "cls")
+		cmd.Stdout = os.Stdout
+		cmd.Run()
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// MetricsHandler renders the collector state in Prometheus text exposition
+// format: rps, success/error counters (errors broken down by status code),
+// and a latency histogram over the collector's configured
+// (--metrics-buckets) buckets, as answered by the configured
+// --latency-estimator.
+func (c *Collector) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := c.Snapshot()
+		rps := float64(snap.Requests) / snap.Elapsed.Seconds()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintf(w, "# HELP go_req_rps Average requests per second since the run started.\n")
+		fmt.Fprintf(w, "# TYPE go_req_rps gauge\n")
+		fmt.Fprintf(w, "go_req_rps %f\n", rps)
+
+		fmt.Fprintf(w, "# HELP go_req_success_total Total successful requests.\n")
+		fmt.Fprintf(w, "# TYPE go_req_success_total counter\n")
+		fmt.Fprintf(w, "go_req_success_total %d\n", snap.SuccessCount)
+
+		fmt.Fprintf(w, "# HELP go_req_error_total Total failed requests, by status code.\n")
+		fmt.Fprintf(w, "# TYPE go_req_error_total counter\n")
+		statuses := make([]string, 0, len(snap.ErrorsByStatus))
+		for status := range snap.ErrorsByStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(w, "go_req_error_total{status=%q} %d\n", status, snap.ErrorsByStatus[status])
+		}
+
+		fmt.Fprintf(w, "# HELP go_req_latency_seconds Latency of successful requests.\n")
+		fmt.Fprintf(w, "# TYPE go_req_latency_seconds histogram\n")
+		counts := c.LatencyBucketCounts()
+		for i, bound := range c.latencyBuckets {
+			fmt.Fprintf(w, "go_req_latency_seconds_bucket{le=%q} %d\n", formatBound(bound), counts[i])
+		}
+		fmt.Fprintf(w, "go_req_latency_seconds_bucket{le=\"+Inf\"} %d\n", snap.SuccessCount)
+		fmt.Fprintf(w, "go_req_latency_seconds_sum %f\n", snap.AvgDuration.Seconds()*float64(snap.SuccessCount))
+		fmt.Fprintf(w, "go_req_latency_seconds_count %d\n", snap.SuccessCount)
+
+		if len(snap.Steps) > 0 {
+			fmt.Fprintf(w, "# HELP go_req_step_success_total Total successful requests, by scenario step.\n")
+			fmt.Fprintf(w, "# TYPE go_req_step_success_total counter\n")
+			fmt.Fprintf(w, "# HELP go_req_step_error_total Total failed requests, by scenario step.\n")
+			fmt.Fprintf(w, "# TYPE go_req_step_error_total counter\n")
+			for _, name := range sortedStepNames(snap.Steps) {
+				s := snap.Steps[name]
+				fmt.Fprintf(w, "go_req_step_success_total{step=%q} %d\n", name, s.SuccessCount)
+				fmt.Fprintf(w, "go_req_step_error_total{step=%q} %d\n", name, s.ErrorCount)
+			}
+		}
+	})
+}
+
+func sortedStepNames(steps map[string]StepStats) []string {
+	names := make([]string, 0, len(steps))
+	for name := range steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatBound(d time.Duration) string {
+	return fmt.Sprintf("%g", d.Seconds())
+}
+
+// StreamSnapshot is the JSON payload written once per second to
+// /metrics/stream, modeled after Consul's /v1/agent/metrics/stream.
+type StreamSnapshot struct {
+	Timestamp    time.Time            `json:"timestamp"`
+	Requests     int                  `json:"requests"`
+	RPS          float64              `json:"rps"`
+	SuccessCount int                  `json:"success_count"`
+	ErrorCount   int                  `json:"error_count"`
+	Errors       map[string]int       `json:"errors_by_status"`
+	P50          time.Duration        `json:"p50"`
+	P90          time.Duration        `json:"p90"`
+	P95          time.Duration        `json:"p95"`
+	P99          time.Duration        `json:"p99"`
+	Steps        map[string]StepStats `json:"steps,omitempty"`
+}
+
+// StreamHandler writes a JSON-encoded StreamSnapshot once per second for as long
+// as the client stays connected, so a dashboard can subscribe instead of
+// polling /metrics.
+func (c *Collector) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				snap := c.Snapshot()
+				s := StreamSnapshot{
+					Timestamp:    time.Now(),
+					Requests:     snap.Requests,
+					RPS:          float64(snap.Requests) / snap.Elapsed.Seconds(),
+					SuccessCount: snap.SuccessCount,
+					ErrorCount:   snap.ErrorCount,
+					Errors:       snap.ErrorsByStatus,
+					P50:          snap.P50,
+					P90:          snap.P90,
+					P95:          snap.P95,
+					P99:          snap.P99,
+					Steps:        snap.Steps,
+				}
+				if err := enc.Encode(s); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// serveMetrics starts the HTTP server exposing /metrics and
+// /metrics/stream. It runs until the process exits, logging (not failing)
+// if the listener cannot be started.
+func serveMetrics(listen string, collector *Collector) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector.MetricsHandler())
+	mux.Handle("/metrics/stream", collector.StreamHandler())
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		log.Printf("metrics server stopped: %v", err)
+	}
+}
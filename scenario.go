@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a workload definition loaded from a YAML or JSON file via
+// --scenario. It either runs its Steps as a weighted-random mix, or, when
+// Chain is true, walks them in order on every iteration so later steps can
+// extract values from earlier responses into variables.
+type Scenario struct {
+	Chain bool   `yaml:"chain" json:"chain"`
+	Steps []Step `yaml:"steps" json:"steps"`
+}
+
+// Step is a single named request definition within a Scenario. URL,
+// Headers and Body may reference variables extracted by earlier steps
+// using {{name}}.
+type Step struct {
+	Name    string            `yaml:"name" json:"name"`
+	Method  string            `yaml:"method" json:"method"`
+	URL     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Body    string            `yaml:"body" json:"body"`
+	Status  []int             `yaml:"status" json:"status"`
+	Weight  int               `yaml:"weight" json:"weight"`
+	Extract []Extraction      `yaml:"extract" json:"extract"`
+}
+
+// Extraction pulls a value out of a step's response body and stores it
+// under Var for later steps to reference. Exactly one of JSONPath or Regex
+// should be set; if Regex is set, the value is the first capture group.
+type Extraction struct {
+	Var      string `yaml:"var" json:"var"`
+	JSONPath string `yaml:"jsonpath" json:"jsonpath"`
+	Regex    string `yaml:"regex" json:"regex"`
+
+	// compiled is Regex compiled once at load time, so the hot request
+	// path doesn't recompile the same pattern on every response.
+	compiled *regexp.Regexp `yaml:"-" json:"-"`
+}
+
+// LoadScenario reads and parses a scenario file, selecting the decoder by
+// file extension (.json vs .yaml/.yml), and fills in step defaults.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario file: %w", err)
+	}
+
+	var scenario Scenario
+	if filepath.Ext(path) == ".json" {
+		if err := json.Unmarshal(data, &scenario); err != nil {
+			return nil, fmt.Errorf("parsing scenario json: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &scenario); err != nil {
+			return nil, fmt.Errorf("parsing scenario yaml: %w", err)
+		}
+	}
+
+	if len(scenario.Steps) == 0 {
+		return nil, fmt.Errorf("scenario %s defines no steps", path)
+	}
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if step.Method == "" {
+			step.Method = "GET"
+		}
+		if len(step.Status) == 0 {
+			step.Status = []int{200}
+		}
+		if step.Weight <= 0 {
+			step.Weight = 1
+		}
+		for j := range step.Extract {
+			ex := &step.Extract[j]
+			if ex.Regex == "" {
+				continue
+			}
+			re, err := regexp.Compile(ex.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("step %s: invalid regex %q: %w", step.Name, ex.Regex, err)
+			}
+			ex.compiled = re
+		}
+	}
+	return &scenario, nil
+}
+
+// VarStore holds named variables extracted from responses during a single
+// chain iteration, and expands {{name}} references in later steps.
+type VarStore struct {
+	mu   sync.RWMutex
+	vars map[string]string
+}
+
+func NewVarStore() *VarStore {
+	return &VarStore{vars: make(map[string]string)}
+}
+
+func (v *VarStore) Set(name, value string) {
+	v.mu.Lock()
+	v.vars[name] = value
+	v.mu.Unlock()
+}
+
+func (v *VarStore) expand(template string) string {
+	if template == "" {
+		return template
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	result := template
+	for name, value := range v.vars {
+		result = strings.ReplaceAll(result, "{{"+name+"}}", value)
+	}
+	return result
+}
+
+// weightedPicker selects steps at random, proportional to their weight.
+type weightedPicker struct {
+	steps      []Step
+	cumulative []int
+	total      int
+}
+
+func newWeightedPicker(steps []Step) *weightedPicker {
+	p := &weightedPicker{steps: steps}
+	sum := 0
+	for _, s := range steps {
+		sum += s.Weight
+		p.cumulative = append(p.cumulative, sum)
+	}
+	p.total = sum
+	return p
+}
+
+func (p *weightedPicker) pick() Step {
+	r := rand.Intn(p.total) + 1
+	for i, c := range p.cumulative {
+		if r <= c {
+			return p.steps[i]
+		}
+	}
+	return p.steps[len(p.steps)-1]
+}
+
+// runScenarioIteration executes one unit of scenario work: the full
+// ordered chain when the scenario is chained, or a single weighted-random
+// step otherwise. Each iteration gets its own VarStore, so extracted
+// variables don't leak across concurrent iterations.
+func runScenarioIteration(client *http.Client, scenario *Scenario, picker *weightedPicker, timeout time.Duration, collector *Collector) {
+	vars := NewVarStore()
+	if scenario.Chain {
+		for _, step := range scenario.Steps {
+			runScenarioStep(client, step, vars, timeout, collector)
+		}
+		return
+	}
+	runScenarioStep(client, picker.pick(), vars, timeout, collector)
+}
+
+// runScenarioStep executes a single step, expanding {{var}} templates from
+// vars, recording success/error stats under the step's name, and running
+// any extractions against the response body into vars.
+func runScenarioStep(client *http.Client, step Step, vars *VarStore, timeout time.Duration, collector *Collector) {
+	start := time.Now()
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var bodyReader io.Reader
+	if step.Body != "" {
+		bodyReader = strings.NewReader(vars.expand(step.Body))
+	}
+	req, err := http.NewRequestWithContext(ctx, step.Method, vars.expand(step.URL), bodyReader)
+	if err != nil {
+		collector.RecordStepError(step.Name, "Error creating request")
+		return
+	}
+	for k, v := range step.Headers {
+		req.Header.Set(k, vars.expand(v))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		collector.RecordStepError(step.Name, "Error making request")
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	elapsed := time.Since(start)
+
+	if !statusExpected(resp.StatusCode, step.Status) {
+		collector.RecordStepError(step.Name, fmt.Sprintf("%d", resp.StatusCode))
+		return
+	}
+
+	for _, ex := range step.Extract {
+		if value, ok := extractValue(body, ex); ok {
+			vars.Set(ex.Var, value)
+		}
+	}
+
+	collector.RecordStepSuccess(step.Name, elapsed)
+}
+
+func statusExpected(got int, want []int) bool {
+	for _, w := range want {
+		if got == w {
+			return true
+		}
+	}
+	return false
+}
+
+func extractValue(body []byte, ex Extraction) (string, bool) {
+	if ex.JSONPath != "" {
+		result := gjson.GetBytes(body, ex.JSONPath)
+		if !result.Exists() {
+			return "", false
+		}
+		return result.String(), true
+	}
+	if ex.compiled != nil {
+		match := ex.compiled.FindSubmatch(body)
+		if len(match) < 2 {
+			return "", false
+		}
+		return string(match[1]), true
+	}
+	return "", false
+}
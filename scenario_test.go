@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestWeightedPickerDistribution(t *testing.T) {
+	steps := []Step{
+		{Name: "light", Weight: 1},
+		{Name: "heavy", Weight: 3},
+	}
+	p := newWeightedPicker(steps)
+
+	const n = 20000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[p.pick().Name]++
+	}
+
+	// "heavy" carries 3x the weight of "light", so it should land around
+	// 75% of picks; allow generous slack since this is a random sample.
+	gotFrac := float64(counts["heavy"]) / float64(n)
+	if gotFrac < 0.70 || gotFrac > 0.80 {
+		t.Fatalf("heavy step picked %.2f%% of the time, want ~75%%", gotFrac*100)
+	}
+}
+
+func TestWeightedPickerSingleStep(t *testing.T) {
+	steps := []Step{{Name: "only", Weight: 1}}
+	p := newWeightedPicker(steps)
+
+	for i := 0; i < 100; i++ {
+		if got := p.pick().Name; got != "only" {
+			t.Fatalf("pick() = %q, want %q", got, "only")
+		}
+	}
+}